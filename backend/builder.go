@@ -0,0 +1,212 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// =============================================================================
+// MULTI-FILE PROJECTS & DEPENDENCY CACHE
+// =============================================================================
+//
+// materialize lays a RunRequest's Files out on disk for the sandbox, and
+// resolveDependencies turns an optional Manifest into a content-addressed,
+// LRU-evicted host directory of installed dependencies that's bind-mounted
+// read-only into the sandbox instead of being reinstalled on every run.
+
+type File struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// Manifest describes a single dependency file. Filename selects the
+// installer: requirements.txt (pip), package.json (npm), go.mod
+// (go mod download), pom.xml (maven), build.gradle (gradle).
+type Manifest struct {
+	Filename string `json:"filename"`
+	Content  string `json:"content"`
+}
+
+var (
+	cacheRoot   = getEnv("BUILD_CACHE_DIR", filepath.Join(os.TempDir(), "runner-build-cache"))
+	cacheBudget = int64(2 * 1024 * 1024 * 1024) // 2GB, LRU-evicted
+)
+
+type manifestRule struct {
+	MountPath string // where dependencies land inside the sandbox
+	Install   string // command run inside the language image to populate MountPath
+}
+
+var manifestInstallers = map[string]manifestRule{
+	"requirements.txt": {MountPath: "/app/.venv", Install: "python3 -m venv /app/.venv && /app/.venv/bin/pip install -q -r requirements.txt"},
+	"package.json":     {MountPath: "/app/node_modules", Install: "npm install --silent"},
+	"go.mod":           {MountPath: "/root/go/pkg/mod", Install: "go mod download"},
+	"pom.xml":          {MountPath: "/root/.m2", Install: "mvn -q -B dependency:go-offline"},
+	"build.gradle":     {MountPath: "/root/.gradle", Install: "gradle --quiet dependencies"},
+}
+
+// materialize writes a RunRequest's source tree into tmp: either the
+// single legacy Code field under lang.Filename, or the full Files list for
+// multi-file projects. Files is expected to already include the manifest
+// itself when one is present, since installers run relative to tmp.
+func materialize(tmp, code string, lang LangConfig, files []File) error {
+	if len(files) == 0 {
+		return os.WriteFile(filepath.Join(tmp, lang.Filename), []byte(code), 0644)
+	}
+	for _, f := range files {
+		dest := filepath.Join(tmp, filepath.Clean("/"+f.Path))
+		if err := os.MkdirAll(filepath.Dir(dest), 0777); err != nil {
+			return err
+		}
+		if err := os.WriteFile(dest, []byte(f.Content), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type cacheEntry struct {
+	path     string
+	size     int64
+	lastUsed time.Time
+}
+
+var (
+	cacheMu      sync.Mutex
+	cacheEntries = map[string]*cacheEntry{}
+
+	// buildGroup collapses concurrent resolveDependencies calls for the same
+	// manifest hash into a single install run, so two requests submitting
+	// the identical requirements.txt don't race each other's docker run into
+	// the same hostDir (and the failure path of one doesn't os.RemoveAll a
+	// directory the other is still populating).
+	buildGroup singleflight.Group
+)
+
+// manifestHash fingerprints a manifest so identical dependency sets share a
+// cache entry regardless of the surrounding source code.
+func manifestHash(m Manifest) string {
+	sum := sha256.Sum256([]byte(m.Filename + "\x00" + m.Content))
+	return hex.EncodeToString(sum[:])
+}
+
+// resolveDependencies returns the host directory holding m's resolved
+// dependencies, populating it via lang.Image on a cache miss.
+func resolveDependencies(tmp string, lang LangConfig, m *Manifest) (hostDir, mountPath string, err error) {
+	if m == nil {
+		return "", "", nil
+	}
+	rule, ok := manifestInstallers[m.Filename]
+	if !ok {
+		return "", "", fmt.Errorf("unsupported manifest: %s", m.Filename)
+	}
+
+	key := manifestHash(*m)
+	hostDir = filepath.Join(cacheRoot, key)
+
+	cacheMu.Lock()
+	entry, hit := cacheEntries[key]
+	cacheMu.Unlock()
+	if hit {
+		cacheMu.Lock()
+		entry.lastUsed = time.Now()
+		cacheMu.Unlock()
+		return hostDir, rule.MountPath, nil
+	}
+
+	// Collapse concurrent misses for the same key into one install: the
+	// first caller to arrive runs docker, everyone else waits on it and
+	// reuses its result instead of racing a second install into hostDir.
+	_, err = buildGroup.Do(key, func() (interface{}, error) {
+		cacheMu.Lock()
+		_, hit := cacheEntries[key]
+		cacheMu.Unlock()
+		if hit {
+			return nil, nil
+		}
+
+		if err := os.MkdirAll(hostDir, 0777); err != nil {
+			return nil, err
+		}
+
+		cmd := exec.Command("docker", "run", "--rm",
+			"-v", tmp+":/app:rw",
+			"-v", hostDir+":"+rule.MountPath+":rw",
+			"-w", "/app",
+			lang.Image,
+			"sh", "-c", rule.Install,
+		)
+		if err := cmd.Run(); err != nil {
+			os.RemoveAll(hostDir)
+			return nil, err
+		}
+
+		cacheMu.Lock()
+		cacheEntries[key] = &cacheEntry{path: hostDir, size: dirSize(hostDir), lastUsed: time.Now()}
+		cacheMu.Unlock()
+		evictLRU()
+		return nil, nil
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	cacheMu.Lock()
+	if e, ok := cacheEntries[key]; ok {
+		e.lastUsed = time.Now()
+	}
+	cacheMu.Unlock()
+
+	return hostDir, rule.MountPath, nil
+}
+
+func dirSize(dir string) int64 {
+	var total int64
+	filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total
+}
+
+// evictLRU removes the least-recently-used cache entries until the total
+// cache size is back under cacheBudget.
+func evictLRU() {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+
+	var total int64
+	keys := make([]string, 0, len(cacheEntries))
+	for k, e := range cacheEntries {
+		total += e.size
+		keys = append(keys, k)
+	}
+	if total <= cacheBudget {
+		return
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return cacheEntries[keys[i]].lastUsed.Before(cacheEntries[keys[j]].lastUsed)
+	})
+
+	for _, k := range keys {
+		if total <= cacheBudget {
+			return
+		}
+		e := cacheEntries[k]
+		os.RemoveAll(e.path)
+		total -= e.size
+		delete(cacheEntries, k)
+	}
+}
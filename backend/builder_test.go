@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestManifestHashStableAndDistinct(t *testing.T) {
+	a := Manifest{Filename: "requirements.txt", Content: "flask==2.0\n"}
+	b := Manifest{Filename: "requirements.txt", Content: "flask==2.0\n"}
+	c := Manifest{Filename: "requirements.txt", Content: "django==4.0\n"}
+
+	if manifestHash(a) != manifestHash(b) {
+		t.Fatal("identical manifests must hash the same")
+	}
+	if manifestHash(a) == manifestHash(c) {
+		t.Fatal("different manifest content must hash differently")
+	}
+}
+
+func TestEvictLRURemovesOldestUntilUnderBudget(t *testing.T) {
+	savedEntries, savedBudget := cacheEntries, cacheBudget
+	defer func() { cacheEntries, cacheBudget = savedEntries, savedBudget }()
+
+	dir := t.TempDir()
+	mk := func(name string, size int64, age time.Duration) *cacheEntry {
+		p := filepath.Join(dir, name)
+		os.MkdirAll(p, 0777)
+		os.WriteFile(filepath.Join(p, "f"), make([]byte, size), 0644)
+		return &cacheEntry{path: p, size: size, lastUsed: time.Now().Add(-age)}
+	}
+
+	cacheEntries = map[string]*cacheEntry{
+		"old": mk("old", 100, 2*time.Hour),
+		"new": mk("new", 100, time.Minute),
+	}
+	cacheBudget = 150
+
+	evictLRU()
+
+	if _, ok := cacheEntries["old"]; ok {
+		t.Fatal("expected the least-recently-used entry to be evicted")
+	}
+	if _, ok := cacheEntries["new"]; !ok {
+		t.Fatal("expected the recently-used entry to survive eviction")
+	}
+}
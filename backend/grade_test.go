@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCompareOutputExact(t *testing.T) {
+	tc := TestCase{ExpectedStdout: "hello\n"}
+	if ok, _ := compareOutput(tc, "hello\n"); !ok {
+		t.Fatal("expected exact match to pass")
+	}
+	if ok, _ := compareOutput(tc, "hello"); ok {
+		t.Fatal("expected trailing newline mismatch to fail under exact compare")
+	}
+}
+
+func TestCompareOutputTrim(t *testing.T) {
+	tc := TestCase{ExpectedStdout: "hello", Compare: "trim"}
+	if ok, _ := compareOutput(tc, "  hello\n"); !ok {
+		t.Fatal("expected trimmed match to pass")
+	}
+}
+
+func TestCompareOutputRegex(t *testing.T) {
+	tc := TestCase{ExpectedStdout: "^h.llo$", Compare: "regex"}
+	if ok, _ := compareOutput(tc, "hello"); !ok {
+		t.Fatal("expected regex match to pass")
+	}
+	if ok, _ := compareOutput(tc, "goodbye"); ok {
+		t.Fatal("expected regex mismatch to fail")
+	}
+}
+
+func TestCompareOutputJSON(t *testing.T) {
+	tc := TestCase{ExpectedStdout: `{"a":1,"b":[1,2]}`, Compare: "json"}
+	if ok, _ := compareOutput(tc, `{"b":[1,2],"a":1}`); !ok {
+		t.Fatal("expected JSON compare to ignore key order")
+	}
+	if ok, _ := compareOutput(tc, `{"a":2,"b":[1,2]}`); ok {
+		t.Fatal("expected differing JSON values to fail")
+	}
+}
+
+func TestJSONEqualInvalidInput(t *testing.T) {
+	if jsonEqual("not json", `{"a":1}`) {
+		t.Fatal("expected invalid JSON to compare unequal")
+	}
+}
+
+func TestEvictCompileLRURemovesOldestUntilUnderBudget(t *testing.T) {
+	savedCache, savedBudget := compileCache, compileCacheBudget
+	defer func() { compileCache, compileCacheBudget = savedCache, savedBudget }()
+
+	dir := t.TempDir()
+	mk := func(name string, size int64, age time.Duration) *compileCacheEntry {
+		p := filepath.Join(dir, name)
+		os.MkdirAll(p, 0777)
+		os.WriteFile(filepath.Join(p, "f"), make([]byte, size), 0644)
+		return &compileCacheEntry{path: p, size: size, lastUsed: time.Now().Add(-age)}
+	}
+
+	compileCache = map[string]*compileCacheEntry{
+		"old": mk("old", 100, 2*time.Hour),
+		"new": mk("new", 100, time.Minute),
+	}
+	compileCacheBudget = 150
+
+	evictCompileLRU()
+
+	if _, ok := compileCache["old"]; ok {
+		t.Fatal("expected the least-recently-used entry to be evicted")
+	}
+	if _, ok := compileCache["new"]; !ok {
+		t.Fatal("expected the recently-used entry to survive eviction")
+	}
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// =============================================================================
+// JOB QUEUE (POST /api/jobs, GET /api/jobs/{id}, GET /api/jobs/{id}/events)
+// =============================================================================
+//
+// /api/run is synchronous and bounded by lang.Timeout, which can't serve
+// anything close to TimeoutStream. The job queue decouples submission from
+// execution: POST enqueues and returns immediately, GET polls the result,
+// and /events streams status/result updates over SSE for clients that want
+// to avoid polling. Jobs are backed by a JobStore so a single-replica
+// deployment can use the in-process queue while a multi-replica one swaps
+// in Redis.
+
+type JobStatus string
+
+const (
+	JobQueued  JobStatus = "queued"
+	JobRunning JobStatus = "running"
+	JobDone    JobStatus = "done"
+	JobFailed  JobStatus = "failed"
+)
+
+type Job struct {
+	ID        string       `json:"id"`
+	Status    JobStatus    `json:"status"`
+	Language  string       `json:"language"`
+	Result    *RunResponse `json:"result,omitempty"`
+	Error     string       `json:"error,omitempty"`
+	CreatedAt time.Time    `json:"created_at"`
+
+	req RunRequest // unexported: never leaks into the /api/jobs response
+}
+
+// JobEvent is one SSE update pushed while a job runs.
+type JobEvent struct {
+	Status JobStatus    `json:"status"`
+	Result *RunResponse `json:"result,omitempty"`
+	Error  string       `json:"error,omitempty"`
+}
+
+// JobStore persists job state and fans out status updates to subscribers.
+// memoryJobStore is the default; redisJobStore lets multiple replicas share
+// queue state.
+type JobStore interface {
+	Save(job *Job) error
+	Load(id string) (*Job, bool)
+	Publish(id string, ev JobEvent)
+	Subscribe(id string) (<-chan JobEvent, func())
+}
+
+var (
+	jobTTL        = 10 * time.Minute
+	jobStoreOnce  sync.Once
+	jobStoreInst  JobStore
+	jobQueueOnce  sync.Once
+	jobQueue      chan string
+)
+
+func getJobStore() JobStore {
+	jobStoreOnce.Do(func() {
+		if addr := getEnv("REDIS_ADDR", ""); addr != "" {
+			jobStoreInst = newRedisJobStore(addr)
+		} else {
+			jobStoreInst = newMemoryJobStore()
+		}
+	})
+	return jobStoreInst
+}
+
+// startJobWorkers spins up config.MaxConcurrent workers pulling job IDs off
+// jobQueue the first time a job is submitted.
+func startJobWorkers() chan string {
+	jobQueueOnce.Do(func() {
+		jobQueue = make(chan string, 256)
+		for i := 0; i < config.MaxConcurrent; i++ {
+			go jobWorker(jobQueue)
+		}
+	})
+	return jobQueue
+}
+
+func jobWorker(queue chan string) {
+	store := getJobStore()
+	for id := range queue {
+		job, ok := store.Load(id)
+		if !ok {
+			continue
+		}
+		runJob(store, job)
+	}
+}
+
+func runJob(store JobStore, job *Job) {
+	queueWaitSeconds.Observe(time.Since(job.CreatedAt).Seconds())
+	job.Status = JobRunning
+	store.Save(job)
+	store.Publish(job.ID, JobEvent{Status: JobRunning})
+
+	lang := languages[job.Language]
+	resp, err := execute(job.req, lang, config.TimeoutStream, genTraceID())
+	if err != nil {
+		job.Status = JobFailed
+		job.Error = err.Error()
+		store.Save(job)
+		store.Publish(job.ID, JobEvent{Status: JobFailed, Error: job.Error})
+		return
+	}
+
+	job.Status = JobDone
+	job.Result = &resp
+	store.Save(job)
+	store.Publish(job.ID, JobEvent{Status: JobDone, Result: &resp})
+}
+
+func genJobID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// jobsHandler handles POST /api/jobs.
+func jobsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !acquireSlot("jobs", getClientIP(r)) {
+		http.Error(w, "Too many requests", http.StatusTooManyRequests)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, int64(config.MaxCodeSize+config.MaxStdinSize+1024))
+	var req RunRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if _, ok := languages[req.Language]; !ok {
+		http.Error(w, "Unsupported language", http.StatusBadRequest)
+		return
+	}
+
+	job := &Job{ID: genJobID(), Status: JobQueued, Language: req.Language, CreatedAt: time.Now(), req: req}
+	store := getJobStore()
+	store.Save(job)
+	startJobWorkers() <- job.ID
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"job_id":     job.ID,
+		"status_url": "/api/jobs/" + job.ID,
+	})
+}
+
+// jobStatusHandler handles GET /api/jobs/{id} and GET /api/jobs/{id}/events.
+func jobStatusHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/jobs/")
+	if strings.HasSuffix(path, "/events") {
+		jobEventsHandler(w, r, strings.TrimSuffix(path, "/events"))
+		return
+	}
+
+	job, ok := getJobStore().Load(path)
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+func jobEventsHandler(w http.ResponseWriter, r *http.Request, id string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	store := getJobStore()
+
+	// Subscribe before the first Load so a worker that finishes (Save then
+	// Publish) in the gap between them still reaches us through the
+	// channel - otherwise a fast job can finish between this handler's
+	// Load and its Subscribe and the terminal event is lost forever,
+	// leaving the SSE client hanging on a job that already completed.
+	events, unsubscribe := store.Subscribe(id)
+	defer unsubscribe()
+
+	job, ok := store.Load(id)
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	writeEvent := func(ev JobEvent) {
+		data, _ := json.Marshal(ev)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		flusher.Flush()
+	}
+
+	writeEvent(JobEvent{Status: job.Status, Result: job.Result, Error: job.Error})
+	if job.Status == JobDone || job.Status == JobFailed {
+		return
+	}
+
+	for {
+		select {
+		case ev := <-events:
+			writeEvent(ev)
+			if ev.Status == JobDone || ev.Status == JobFailed {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// -----------------------------------------------------------------------------
+// In-process JobStore
+// -----------------------------------------------------------------------------
+
+type memoryJobStore struct {
+	mu   sync.Mutex
+	jobs map[string]*Job
+	subs map[string][]chan JobEvent
+}
+
+func newMemoryJobStore() *memoryJobStore {
+	return &memoryJobStore{jobs: map[string]*Job{}, subs: map[string][]chan JobEvent{}}
+}
+
+func (s *memoryJobStore) Save(job *Job) error {
+	s.mu.Lock()
+	s.jobs[job.ID] = job
+	s.mu.Unlock()
+
+	// Jobs persist for jobTTL so clients that reconnect after the worker
+	// finished can still fetch the result.
+	if job.Status == JobDone || job.Status == JobFailed {
+		time.AfterFunc(jobTTL, func() {
+			s.mu.Lock()
+			delete(s.jobs, job.ID)
+			delete(s.subs, job.ID)
+			s.mu.Unlock()
+		})
+	}
+	return nil
+}
+
+func (s *memoryJobStore) Load(id string) (*Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	return j, ok
+}
+
+func (s *memoryJobStore) Publish(id string, ev JobEvent) {
+	s.mu.Lock()
+	subs := s.subs[id]
+	s.mu.Unlock()
+	for _, ch := range subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+func (s *memoryJobStore) Subscribe(id string) (<-chan JobEvent, func()) {
+	ch := make(chan JobEvent, 8)
+	s.mu.Lock()
+	s.subs[id] = append(s.subs[id], ch)
+	s.mu.Unlock()
+
+	unsubscribe := func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		subs := s.subs[id]
+		for i, c := range subs {
+			if c == ch {
+				s.subs[id] = append(subs[:i], subs[i+1:]...)
+				break
+			}
+		}
+	}
+	return ch, unsubscribe
+}
+
+// -----------------------------------------------------------------------------
+// Redis-backed JobStore, for multi-replica deployments that need shared
+// queue state. Jobs are stored as JSON strings with a jobTTL expiry;
+// Publish/Subscribe ride a Redis pub/sub channel per job ID.
+// -----------------------------------------------------------------------------
+
+type redisJobStore struct {
+	client *redis.Client
+}
+
+func newRedisJobStore(addr string) *redisJobStore {
+	return &redisJobStore{client: redis.NewClient(&redis.Options{Addr: addr})}
+}
+
+func (s *redisJobStore) key(id string) string { return "job:" + id }
+
+// jobEnvelope carries Job's unexported req field across the wire; Job's own
+// JSON tags are what /api/jobs actually returns to clients.
+type jobEnvelope struct {
+	Job
+	Request RunRequest `json:"request"`
+}
+
+func (s *redisJobStore) Save(job *Job) error {
+	data, err := json.Marshal(jobEnvelope{Job: *job, Request: job.req})
+	if err != nil {
+		return err
+	}
+	return s.client.Set(context.Background(), s.key(job.ID), data, jobTTL).Err()
+}
+
+func (s *redisJobStore) Load(id string) (*Job, bool) {
+	data, err := s.client.Get(context.Background(), s.key(id)).Bytes()
+	if err != nil {
+		return nil, false
+	}
+	var env jobEnvelope
+	if json.Unmarshal(data, &env) != nil {
+		return nil, false
+	}
+	job := env.Job
+	job.req = env.Request
+	return &job, true
+}
+
+func (s *redisJobStore) Publish(id string, ev JobEvent) {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	s.client.Publish(context.Background(), s.key(id)+":events", data)
+}
+
+func (s *redisJobStore) Subscribe(id string) (<-chan JobEvent, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	pubsub := s.client.Subscribe(ctx, s.key(id)+":events")
+	out := make(chan JobEvent, 8)
+
+	go func() {
+		defer close(out)
+		for msg := range pubsub.Channel() {
+			var ev JobEvent
+			if json.Unmarshal([]byte(msg.Payload), &ev) == nil {
+				out <- ev
+			}
+		}
+	}()
+
+	return out, func() {
+		cancel()
+		pubsub.Close()
+	}
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"bufio"
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -59,6 +58,7 @@ type LangConfig struct {
 	Compile  string // empty = interpreted
 	Run      string
 	Timeout  time.Duration
+	Sandbox  string // per-language Sandbox backend override, "" = SANDBOX_BACKEND
 }
 
 var languages = map[string]LangConfig{
@@ -67,6 +67,7 @@ var languages = map[string]LangConfig{
 		Image:    "runner-python",
 		Run:      "python3 main.py",
 		Timeout:  5 * time.Second,
+		Sandbox:  "gvisor",
 	},
 	"javascript": {
 		Filename: "main.js",
@@ -94,42 +95,12 @@ var languages = map[string]LangConfig{
 		Compile:  "javac -d /tmp Main.java",
 		Run:      "java -cp /tmp Main",
 		Timeout:  10 * time.Second,
+		Sandbox:  "docker",
 	},
 }
 
-// =============================================================================
-// RATE LIMITING
-// =============================================================================
-
-var (
-	rateLimiter   = make(map[string]int)
-	rateLimiterMu sync.Mutex
-)
-
-func acquireSlot(ip string) bool {
-	rateLimiterMu.Lock()
-	defer rateLimiterMu.Unlock()
-	if rateLimiter[ip] >= config.MaxConcurrent {
-		return false
-	}
-	rateLimiter[ip]++
-	return true
-}
-
-func releaseSlot(ip string) {
-	rateLimiterMu.Lock()
-	defer rateLimiterMu.Unlock()
-	if rateLimiter[ip] > 0 {
-		rateLimiter[ip]--
-	}
-}
-
-func getClientIP(r *http.Request) string {
-	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
-		return strings.Split(fwd, ",")[0]
-	}
-	return r.RemoteAddr
-}
+// Rate limiting (acquireSlot, getClientIP, the Limiter interface and its
+// in-memory/Redis implementations) lives in ratelimit.go.
 
 // =============================================================================
 // CORS MIDDLEWARE
@@ -157,6 +128,12 @@ type RunRequest struct {
 	Language string `json:"language"`
 	Code     string `json:"code"`
 	Stdin    string `json:"stdin"`
+
+	// Files, when non-empty, describes a multi-file project and takes
+	// precedence over Code. Manifest, if present, is resolved through the
+	// build-cache before the sandbox runs.
+	Files    []File    `json:"files,omitempty"`
+	Manifest *Manifest `json:"manifest,omitempty"`
 }
 
 type RunResponse struct {
@@ -169,11 +146,10 @@ func runHandler(w http.ResponseWriter, r *http.Request) {
 	clientIP := getClientIP(r)
 
 	// Rate limit
-	if !acquireSlot(clientIP) {
+	if !acquireSlot("run", clientIP) {
 		http.Error(w, "Too many requests", http.StatusTooManyRequests)
 		return
 	}
-	defer releaseSlot(clientIP)
 
 	// Parse request
 	r.Body = http.MaxBytesReader(w, r.Body, int64(config.MaxCodeSize+config.MaxStdinSize+1024))
@@ -190,125 +166,80 @@ func runHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Execute
-	var resp RunResponse
-	if config.DockerAvail {
-		resp = executeDocker(req.Code, req.Stdin, lang)
-	} else {
-		resp = executeNative(req.Code, req.Stdin, lang)
+	traceID := genTraceID()
+	w.Header().Set("X-Trace-Id", traceID)
+
+	// Execute via the backend configured for this language
+	resp, err := execute(req, lang, lang.Timeout, traceID)
+	if err != nil {
+		resp = RunResponse{Stderr: err.Error()}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
 
-func executeDocker(code, stdin string, lang LangConfig) RunResponse {
-	// Create temp dir
+// execute materializes req's source tree into a fresh temp dir, resolves
+// its dependency manifest (if any) through the build cache, and runs it
+// through the Sandbox resolved for lang, bounded by timeout.
+func execute(req RunRequest, lang LangConfig, timeout time.Duration, traceID string) (RunResponse, error) {
+	ctx, span := startSpan(context.Background(), "execute", traceID)
+	defer span.End()
+
+	logger.Info("run started", "trace_id", traceID, "language", req.Language)
+	start := time.Now()
+	activeSandboxes.Inc()
+	defer activeSandboxes.Dec()
+
 	tmp, err := os.MkdirTemp("", "run-")
 	if err != nil {
-		return RunResponse{Stderr: err.Error()}
+		return RunResponse{}, err
 	}
 	defer os.RemoveAll(tmp)
 	os.Chmod(tmp, 0777)
 
-	// Write code
-	codePath := filepath.Join(tmp, lang.Filename)
-	if err := os.WriteFile(codePath, []byte(code), 0644); err != nil {
-		return RunResponse{Stderr: err.Error()}
+	if err := materialize(tmp, req.Code, lang, req.Files); err != nil {
+		return RunResponse{}, err
 	}
 
-	// Build command
-	runCmd := lang.Run
-	if lang.Compile != "" {
-		runCmd = lang.Compile + " && " + lang.Run
+	spec := RunSpec{Lang: lang, Code: req.Code, Stdin: req.Stdin, TempDir: tmp}
+	if req.Manifest != nil {
+		hostDir, mountPath, err := resolveDependencies(tmp, lang, req.Manifest)
+		if err != nil {
+			return RunResponse{}, err
+		}
+		spec.CacheMount, spec.CacheMountPath = hostDir, mountPath
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), lang.Timeout)
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	args := []string{
-		"run", "--rm", "-i",
-		"--network=none",
-		"--memory=256m",
-		"--memory-swap=256m",
-		"--cpus=1.0",
-		"--pids-limit=128",
-		"--read-only",
-		"--cap-drop=ALL",
-		"--security-opt", "no-new-privileges",
-		"--ulimit", "fsize=10485760:10485760",
-		"--ulimit", "nofile=256:256",
-		"--tmpfs", "/tmp:rw,exec,size=64m",
-		"-v", tmp + ":/app:rw",
-		"-w", "/app",
-		lang.Image,
-		"sh", "-c", runCmd,
-	}
-
-	cmd := exec.CommandContext(ctx, "docker", args...)
-	cmd.Stdin = strings.NewReader(stdin)
-
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &limitedWriter{w: &stdout, limit: config.MaxOutputSize}
-	cmd.Stderr = &limitedWriter{w: &stderr, limit: config.MaxOutputSize}
-
-	err = cmd.Run()
-
-	resp := RunResponse{
-		Stdout:  stdout.String(),
-		Stderr:  stderr.String(),
-		Success: err == nil,
-	}
-
-	if err != nil && resp.Stderr == "" {
-		resp.Stderr = err.Error()
-	}
-
-	return resp
-}
-
-func executeNative(code, stdin string, lang LangConfig) RunResponse {
-	// Fallback for systems without Docker (Termux, etc.)
-	// Only supports interpreted languages safely
-
-	tmp, err := os.MkdirTemp("", "run-")
+	sandbox := resolveSandbox(lang)
+	result, err := sandbox.Run(runCtx, spec)
 	if err != nil {
-		return RunResponse{Stderr: err.Error()}
+		return RunResponse{}, err
 	}
-	defer os.RemoveAll(tmp)
-
-	codePath := filepath.Join(tmp, lang.Filename)
-	if err := os.WriteFile(codePath, []byte(code), 0644); err != nil {
-		return RunResponse{Stderr: err.Error()}
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), lang.Timeout)
-	defer cancel()
 
-	var cmd *exec.Cmd
-	switch lang.Filename {
-	case "main.py":
-		cmd = exec.CommandContext(ctx, "python3", codePath)
-	case "main.js":
-		cmd = exec.CommandContext(ctx, "node", codePath)
-	default:
-		return RunResponse{Stderr: "Native execution not supported for this language. Install Docker."}
+	status := "ok"
+	if runCtx.Err() == context.DeadlineExceeded {
+		status = "timeout"
+		timeoutsTotal.WithLabelValues(req.Language).Inc()
+	} else if result.OOMKilled {
+		status = "oom"
+		oomKillsTotal.WithLabelValues(req.Language).Inc()
+	} else if !result.Success {
+		status = "error"
 	}
-
-	cmd.Dir = tmp
-	cmd.Stdin = strings.NewReader(stdin)
-
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	err = cmd.Run()
+	runsTotal.WithLabelValues(req.Language, status).Inc()
+	executionLatency.WithLabelValues(req.Language).Observe(time.Since(start).Seconds())
+	outputSizeBytes.WithLabelValues(req.Language).Observe(float64(len(result.Stdout) + len(result.Stderr)))
+	logger.Info("run finished", "trace_id", traceID, "language", req.Language, "status", status, "duration_ms", time.Since(start).Milliseconds())
 
 	return RunResponse{
-		Stdout:  stdout.String(),
-		Stderr:  stderr.String(),
-		Success: err == nil,
-	}
+		Stdout:  result.Stdout,
+		Stderr:  result.Stderr,
+		Success: result.Success,
+	}, nil
 }
 
 // =============================================================================
@@ -329,49 +260,82 @@ type WSMessage struct {
 }
 
 type WSResponse struct {
-	Type string `json:"type"` // "stdout", "stderr", "exit", "error"
+	Type string `json:"type"` // "trace", "error"; process output and exit go out as binary frames
 	Data string `json:"data"`
 	Code int    `json:"code,omitempty"` // exit code
 }
 
+// Binary frame tags for server->client output, mirroring Docker's stdcopy
+// multiplexing: a 1-byte stream tag followed by raw bytes. "control" carries
+// a JSON-encoded WSResponse for anything that isn't raw process output.
+const (
+	streamStdout  byte = 0
+	streamStderr  byte = 1
+	streamExit    byte = 2
+	streamControl byte = 3
+)
+
+// writeFrame sends tag+data as one binary WebSocket frame. conn.WriteMessage
+// isn't safe for concurrent use, so every writer goes through writeMu.
+func writeFrame(conn *websocket.Conn, mu *sync.Mutex, tag byte, data []byte) error {
+	mu.Lock()
+	defer mu.Unlock()
+	frame := make([]byte, 1+len(data))
+	frame[0] = tag
+	copy(frame[1:], data)
+	return conn.WriteMessage(websocket.BinaryMessage, frame)
+}
+
+func writeControl(conn *websocket.Conn, mu *sync.Mutex, resp WSResponse) {
+	data, _ := json.Marshal(resp)
+	writeFrame(conn, mu, streamControl, data)
+}
+
 func wsHandler(w http.ResponseWriter, r *http.Request) {
 	clientIP := getClientIP(r)
+	traceID := genTraceID()
 
-	if !acquireSlot(clientIP) {
+	if !acquireSlot("ws", clientIP) {
 		http.Error(w, "Too many connections", http.StatusTooManyRequests)
 		return
 	}
-	defer releaseSlot(clientIP)
 
-	conn, err := upgrader.Upgrade(w, r, nil)
+	conn, err := upgrader.Upgrade(w, r, http.Header{"X-Trace-Id": []string{traceID}})
 	if err != nil {
 		return
 	}
 	defer conn.Close()
 
-	fmt.Println("\n----------------------------------------")
-	fmt.Println("NEW CONNECTION from", clientIP)
+	logger.Info("ws connected", "trace_id", traceID, "client_ip", clientIP)
+
+	var writeMu sync.Mutex
+
+	// Browser WebSocket clients can't read the upgrade response's headers,
+	// so the trace ID also goes out as the first control frame.
+	writeControl(conn, &writeMu, WSResponse{Type: "trace", Data: traceID})
 
 	// Read init message
 	var initMsg WSMessage
 	if err := conn.ReadJSON(&initMsg); err != nil || initMsg.Type != "init" {
-		conn.WriteJSON(WSResponse{Type: "error", Data: "Expected init message"})
+		writeControl(conn, &writeMu, WSResponse{Type: "error", Data: "Expected init message"})
 		return
 	}
 
 	lang, ok := languages[initMsg.Language]
 	if !ok {
-		conn.WriteJSON(WSResponse{Type: "error", Data: "Unsupported language"})
+		writeControl(conn, &writeMu, WSResponse{Type: "error", Data: "Unsupported language"})
 		return
 	}
 
-	fmt.Printf("RUNNING: %s\n", initMsg.Language)
-	fmt.Println("----------------------------------------")
+	ctx, span := startSpan(context.Background(), "ws_stream", traceID)
+	defer span.End()
+
+	logger.Info("ws running", "trace_id", traceID, "language", initMsg.Language)
 
 	// Create temp dir
 	tmp, err := os.MkdirTemp("", "ws-run-")
 	if err != nil {
-		conn.WriteJSON(WSResponse{Type: "error", Data: err.Error()})
+		writeControl(conn, &writeMu, WSResponse{Type: "error", Data: err.Error()})
 		return
 	}
 	defer os.RemoveAll(tmp)
@@ -380,129 +344,63 @@ func wsHandler(w http.ResponseWriter, r *http.Request) {
 	// Write code
 	codePath := filepath.Join(tmp, lang.Filename)
 	if err := os.WriteFile(codePath, []byte(initMsg.Code), 0644); err != nil {
-		conn.WriteJSON(WSResponse{Type: "error", Data: err.Error()})
+		writeControl(conn, &writeMu, WSResponse{Type: "error", Data: err.Error()})
 		return
 	}
 
-	// Build run command
-	runCmd := lang.Run
-	if lang.Compile != "" {
-		runCmd = lang.Compile + " && " + lang.Run
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), config.TimeoutStream)
+	ctx, cancel := context.WithTimeout(ctx, config.TimeoutStream)
 	defer cancel()
 
-	var cmd *exec.Cmd
-	if config.DockerAvail {
-		args := []string{
-			"run", "--rm", "-i",
-			"--network=none",
-			"--memory=256m",
-			"--memory-swap=256m",
-			"--cpus=1.0",
-			"--pids-limit=128",
-			"--read-only",
-			"--cap-drop=ALL",
-			"--security-opt", "no-new-privileges",
-			"--tmpfs", "/tmp:rw,exec,size=64m",
-			"-v", tmp + ":/app:rw",
-			"-w", "/app",
-			lang.Image,
-			"sh", "-c", runCmd,
-		}
-		cmd = exec.CommandContext(ctx, "docker", args...)
-	} else {
-		// Native fallback
-		switch lang.Filename {
-		case "main.py":
-			cmd = exec.CommandContext(ctx, "python3", codePath)
-		case "main.js":
-			cmd = exec.CommandContext(ctx, "node", codePath)
-		default:
-			conn.WriteJSON(WSResponse{Type: "error", Data: "Native execution not supported"})
-			return
-		}
-		cmd.Dir = tmp
-	}
-
-	// Setup pipes
-	stdinPipe, err := cmd.StdinPipe()
-	if err != nil {
-		conn.WriteJSON(WSResponse{Type: "error", Data: err.Error()})
-		return
-	}
-
-	stdoutPipe, err := cmd.StdoutPipe()
+	sandbox := resolveSandbox(lang)
+	handles, err := sandbox.Stream(ctx, RunSpec{Lang: lang, Code: initMsg.Code, TempDir: tmp})
 	if err != nil {
-		conn.WriteJSON(WSResponse{Type: "error", Data: err.Error()})
+		writeControl(conn, &writeMu, WSResponse{Type: "error", Data: err.Error()})
 		return
 	}
-
-	stderrPipe, err := cmd.StderrPipe()
-	if err != nil {
-		conn.WriteJSON(WSResponse{Type: "error", Data: err.Error()})
-		return
+	if initMsg.Cols > 0 && initMsg.Rows > 0 {
+		handles.Resize(initMsg.Cols, initMsg.Rows)
 	}
+	stdinPipe := handles.Stdin
 
-	// Start process
-	if err := cmd.Start(); err != nil {
-		conn.WriteJSON(WSResponse{Type: "error", Data: err.Error()})
-		return
-	}
-
-	fmt.Println("STARTED")
+	logger.Info("ws started", "trace_id", traceID)
 
 	var wg sync.WaitGroup
 	done := make(chan struct{})
 
-	// Stream stdout
-	wg.Add(1)
-	go func() {
+	// Stream output. A real PTY merges stdout/stderr, so when one is
+	// allocated there's a single reader tagged as stdout; otherwise stdout
+	// and stderr are read (and tagged) independently.
+	streamPipe := func(r io.Reader, tag byte, label string) {
 		defer wg.Done()
-		reader := bufio.NewReader(stdoutPipe)
+		reader := bufio.NewReader(r)
 		buf := make([]byte, 1024)
 		for {
 			n, err := reader.Read(buf)
 			if n > 0 {
-				output := string(buf[:n])
-				preview := strings.ReplaceAll(output, "\n", "\\n")
+				output := buf[:n]
+				preview := strings.ReplaceAll(string(output), "\n", "\\n")
 				if len(preview) > 80 {
 					preview = preview[:80] + "..."
 				}
-				fmt.Printf(">> OUT: %s\n", preview)
-				conn.WriteJSON(WSResponse{Type: "stdout", Data: output})
+				logger.Debug("ws output", "trace_id", traceID, "stream", label, "preview", preview)
+				writeFrame(conn, &writeMu, tag, output)
 			}
 			if err != nil {
 				return
 			}
 		}
-	}()
+	}
 
-	// Stream stderr
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		reader := bufio.NewReader(stderrPipe)
-		buf := make([]byte, 1024)
-		for {
-			n, err := reader.Read(buf)
-			if n > 0 {
-				output := string(buf[:n])
-				preview := strings.ReplaceAll(output, "\n", "\\n")
-				if len(preview) > 80 {
-					preview = preview[:80] + "..."
-				}
-				fmt.Printf(">> ERR: %s\n", preview)
-				conn.WriteJSON(WSResponse{Type: "stderr", Data: output})
-			}
-			if err != nil {
-				return
-			}
-		}
-	}()
+	if handles.Pty != nil {
+		wg.Add(1)
+		go streamPipe(handles.Pty, streamStdout, "OUT")
+	} else {
+		wg.Add(2)
+		go streamPipe(handles.Stdout, streamStdout, "OUT")
+		go streamPipe(handles.Stderr, streamStderr, "ERR")
+	}
 
-	// Handle incoming messages (stdin)
+	// Handle incoming messages (stdin, resize, eof, kill)
 	var inputBuffer strings.Builder
 	wg.Add(1)
 	go func() {
@@ -522,17 +420,20 @@ func wsHandler(w http.ResponseWriter, r *http.Request) {
 				if input == "\n" || input == "\r" || input == "\r\n" {
 					line := inputBuffer.String()
 					inputBuffer.Reset()
-					fmt.Printf(">> IN:  %s<enter>\n", line)
+					logger.Debug("ws input", "trace_id", traceID, "line", line)
 				} else {
 					inputBuffer.WriteString(input)
 				}
+			case "resize":
+				logger.Debug("ws resize", "trace_id", traceID, "cols", msg.Cols, "rows", msg.Rows)
+				handles.Resize(msg.Cols, msg.Rows)
 			case "eof":
 				// Close stdin - signals EOF to the process (like Ctrl+D)
-				fmt.Println(">> EOF (Ctrl+D)")
+				logger.Info("ws eof", "trace_id", traceID)
 				stdinPipe.Close()
 				return
 			case "kill":
-				fmt.Println(">> KILL")
+				logger.Info("ws kill", "trace_id", traceID)
 				cancel()
 				return
 			}
@@ -540,8 +441,9 @@ func wsHandler(w http.ResponseWriter, r *http.Request) {
 	}()
 
 	// Wait for process
+	var waitErr error
 	go func() {
-		cmd.Wait()
+		waitErr = handles.Wait()
 		close(done)
 	}()
 
@@ -549,18 +451,20 @@ func wsHandler(w http.ResponseWriter, r *http.Request) {
 	wg.Wait()
 
 	exitCode := 0
-	if cmd.ProcessState != nil {
-		exitCode = cmd.ProcessState.ExitCode()
+	if exitErr, ok := waitErr.(*exec.ExitError); ok {
+		exitCode = exitErr.ExitCode()
+	} else if waitErr != nil {
+		exitCode = -1
 	}
 
-	if exitCode == 0 {
-		fmt.Println("DONE (exit 0)")
-	} else {
-		fmt.Printf("FAILED (exit %d)\n", exitCode)
+	status := "ok"
+	if exitCode != 0 {
+		status = "error"
 	}
-	fmt.Println("----------------------------------------\n")
+	runsTotal.WithLabelValues(initMsg.Language, status).Inc()
+	logger.Info("ws finished", "trace_id", traceID, "exit_code", exitCode)
 
-	conn.WriteJSON(WSResponse{Type: "exit", Code: exitCode})
+	writeFrame(conn, &writeMu, streamExit, []byte(fmt.Sprintf("%d", exitCode)))
 }
 
 // =============================================================================
@@ -667,6 +571,10 @@ func main() {
 	http.HandleFunc("/api/health", corsMiddleware(healthHandler))
 	http.HandleFunc("/api/run", corsMiddleware(runHandler))
 	http.HandleFunc("/api/ws", wsHandler)
+	http.HandleFunc("/api/jobs", corsMiddleware(jobsHandler))
+	http.HandleFunc("/api/jobs/", corsMiddleware(jobStatusHandler))
+	http.HandleFunc("/api/grade", corsMiddleware(gradeHandler))
+	http.Handle("/metrics", metricsHandler())
 
 	// Serve frontend static files if dist exists
 	if serveFrontend {
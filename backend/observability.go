@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// =============================================================================
+// OBSERVABILITY: structured logging, trace IDs, Prometheus metrics, OTel spans
+// =============================================================================
+//
+// Every run gets a trace ID (returned as X-Trace-Id on HTTP, carried in WS
+// control messages) that ties its log lines and span together. /metrics
+// exposes Prometheus counters/histograms/gauges for everything an operator
+// needs to see where time and capacity go.
+
+var logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+var tracer = otel.Tracer("code-runner")
+
+func genTraceID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+var (
+	runsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "runner_runs_total",
+		Help: "Total code executions, by language and exit status.",
+	}, []string{"language", "status"})
+
+	rateLimitRejects = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "runner_rate_limit_rejects_total",
+		Help: "Requests rejected by the rate limiter, by endpoint.",
+	}, []string{"endpoint"})
+
+	timeoutsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "runner_timeouts_total",
+		Help: "Executions that hit their timeout.",
+	}, []string{"language"})
+
+	oomKillsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "runner_oom_kills_total",
+		Help: "Executions killed by the OOM killer, detected via docker inspect.",
+	}, []string{"language"})
+
+	executionLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "runner_execution_latency_seconds",
+		Help:    "End-to-end execution latency.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"language"})
+
+	compileLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "runner_compile_latency_seconds",
+		Help:    "Compile stage latency.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"language"})
+
+	queueWaitSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "runner_queue_wait_seconds",
+		Help:    "Time a job spent waiting for a worker or a pooled container.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	outputSizeBytes = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "runner_output_size_bytes",
+		Help:    "Size of captured stdout+stderr.",
+		Buckets: prometheus.ExponentialBuckets(64, 4, 8),
+	}, []string{"language"})
+
+	activeSandboxes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "runner_active_sandboxes",
+		Help: "Executions currently in flight.",
+	})
+
+	poolUtilization = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "runner_pool_utilization",
+		Help: "Fraction of a language's RunnerPool currently checked out.",
+	}, []string{"language"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		runsTotal, rateLimitRejects, timeoutsTotal, oomKillsTotal,
+		executionLatency, compileLatency, queueWaitSeconds, outputSizeBytes,
+		activeSandboxes, poolUtilization,
+	)
+}
+
+func metricsHandler() http.Handler {
+	return promhttp.Handler()
+}
+
+// startSpan begins an OTel span for one of the compile/run/stream phases,
+// tagged with the trace ID so logs and spans can be correlated.
+func startSpan(ctx context.Context, name, traceID string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attribute.String("trace_id", traceID)))
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// =============================================================================
+// RUNNER POOL
+// =============================================================================
+//
+// A RunnerPool keeps N long-lived "sleep forever" containers warm per
+// language so jobs can `docker exec` into one instead of paying the
+// 300-800ms `docker run` startup cost on every request. It only applies to
+// the Docker backend; other Sandbox implementations are unaffected.
+
+var (
+	poolEnabled  = getEnv("RUNNER_POOL", "") == "1"
+	poolSize     = 2
+	recycleAfter = 50 // jobs per container before it's torn down and replaced
+)
+
+type pooledContainer struct {
+	id   string
+	jobs int
+	dead bool
+}
+
+// RunnerPool manages the warm containers for a single language image.
+type RunnerPool struct {
+	mu        sync.Mutex
+	lang      string
+	image     string
+	available []*pooledContainer
+
+	waitTotal  time.Duration
+	waitCount  int
+	recycleCnt int
+}
+
+var (
+	poolsMu sync.Mutex
+	pools   = map[string]*RunnerPool{}
+)
+
+// poolFor returns (creating if necessary) the RunnerPool for lang, spawning
+// its initial containers on first use.
+func poolFor(lang LangConfig, langName string) *RunnerPool {
+	poolsMu.Lock()
+	defer poolsMu.Unlock()
+
+	if p, ok := pools[langName]; ok {
+		return p
+	}
+	p := &RunnerPool{lang: langName, image: lang.Image}
+	for i := 0; i < poolSize; i++ {
+		if c, err := p.spawn(); err == nil {
+			p.available = append(p.available, c)
+		}
+	}
+	pools[langName] = p
+	return p
+}
+
+func (p *RunnerPool) spawn() (*pooledContainer, error) {
+	// Hardened the same way as a per-job DockerSandbox container: read-only
+	// rootfs with tmpfs only where a job needs to write (/app for the
+	// source tree and any copied-in dependency cache, /root for
+	// go/m2/gradle caches, /tmp for compiled artifacts), so a job can't
+	// stash files anywhere on the container that would survive for - or
+	// leak into - the next tenant's job once /app is wiped post-run.
+	out, err := exec.Command("docker", "run", "-d",
+		"--network=none",
+		"--memory=256m",
+		"--memory-swap=256m",
+		"--cpus=1.0",
+		"--pids-limit=128",
+		"--read-only",
+		"--cap-drop=ALL",
+		"--security-opt", "no-new-privileges",
+		"--ulimit", "fsize=10485760:10485760",
+		"--ulimit", "nofile=256:256",
+		"--tmpfs", "/tmp:rw,exec,size=64m",
+		"--tmpfs", "/app:rw,exec,size=256m",
+		"--tmpfs", "/root:rw,exec,size=256m",
+		p.image,
+		"sh", "-c", "sleep infinity",
+	).Output()
+	if err != nil {
+		return nil, err
+	}
+	id := string(out)
+	if n := len(id); n > 0 && id[n-1] == '\n' {
+		id = id[:n-1]
+	}
+	return &pooledContainer{id: id}, nil
+}
+
+// healthy reports whether a container is still running via `docker exec true`.
+func (p *RunnerPool) healthy(c *pooledContainer) bool {
+	return exec.Command("docker", "exec", c.id, "true").Run() == nil
+}
+
+// acquire takes a container from the pool, replacing any that failed their
+// health check or exhausted their job budget, and blocks (via polling) until
+// one is free if the pool is momentarily exhausted.
+func (p *RunnerPool) acquire(ctx context.Context) (*pooledContainer, error) {
+	start := time.Now()
+	for {
+		p.mu.Lock()
+		for len(p.available) > 0 {
+			c := p.available[len(p.available)-1]
+			p.available = p.available[:len(p.available)-1]
+
+			if c.dead || c.jobs >= recycleAfter || !p.healthy(c) {
+				p.recycleCnt++
+				exec.Command("docker", "rm", "-f", c.id).Run()
+				if fresh, err := p.spawn(); err == nil {
+					c = fresh
+				} else {
+					continue
+				}
+			}
+
+			p.waitTotal += time.Since(start)
+			p.waitCount++
+			queueWaitSeconds.Observe(time.Since(start).Seconds())
+			p.reportUtilization()
+			p.mu.Unlock()
+			return c, nil
+		}
+		p.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+}
+
+// release returns a container to the pool for reuse by the next job.
+func (p *RunnerPool) release(c *pooledContainer) {
+	c.jobs++
+	p.mu.Lock()
+	p.available = append(p.available, c)
+	p.reportUtilization()
+	p.mu.Unlock()
+}
+
+// reportUtilization updates the poolUtilization gauge for p's language.
+// Callers must hold p.mu.
+func (p *RunnerPool) reportUtilization() {
+	checkedOut := poolSize - len(p.available)
+	poolUtilization.WithLabelValues(p.lang).Set(float64(checkedOut) / float64(poolSize))
+}
+
+// metrics reports a point-in-time snapshot of the pool's idle container
+// count, average acquire wait and recycle count. It is not exported through
+// /metrics.
+func (p *RunnerPool) metrics() (size int, avgWait time.Duration, recycles int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	avg := time.Duration(0)
+	if p.waitCount > 0 {
+		avg = p.waitTotal / time.Duration(p.waitCount)
+	}
+	return len(p.available), avg, p.recycleCnt
+}
+
+// PooledDockerSandbox runs jobs via `docker exec` against a warm container
+// from the RunnerPool instead of a fresh `docker run --rm`.
+type PooledDockerSandbox struct{}
+
+func (PooledDockerSandbox) Run(ctx context.Context, spec RunSpec) (RunResult, error) {
+	langName := ""
+	for name, lc := range languages {
+		if lc.Image == spec.Lang.Image {
+			langName = name
+			break
+		}
+	}
+
+	pool := poolFor(spec.Lang, langName)
+	container, err := pool.acquire(ctx)
+	if err != nil {
+		return RunResult{}, err
+	}
+	defer pool.release(container)
+
+	// Ship the ephemeral source tree into the warm container and clean up
+	// after the job so side effects don't leak into the next reuse.
+	if err := exec.Command("docker", "cp", spec.TempDir+"/.", container.id+":/app").Run(); err != nil {
+		return RunResult{}, err
+	}
+	defer exec.Command("docker", "exec", container.id, "rm", "-rf", "/app").Run()
+
+	// A running container can't gain a new bind mount, so a resolved
+	// dependency cache (see builder.go) is copied in instead of mounted,
+	// same as the source tree above, and wiped the same way afterward.
+	if spec.CacheMount != "" {
+		exec.Command("docker", "exec", container.id, "mkdir", "-p", spec.CacheMountPath).Run()
+		if err := exec.Command("docker", "cp", spec.CacheMount+"/.", container.id+":"+spec.CacheMountPath).Run(); err != nil {
+			return RunResult{}, err
+		}
+		defer exec.Command("docker", "exec", container.id, "rm", "-rf", spec.CacheMountPath).Run()
+	}
+
+	shellCmd := spec.Lang.Run
+	if spec.Lang.Compile != "" {
+		shellCmd = spec.Lang.Compile + " && " + spec.Lang.Run
+	}
+
+	cmd := exec.CommandContext(ctx, "docker", "exec", "-i", "-w", "/app", container.id, "sh", "-c", shellCmd)
+	return runCmd(ctx, cmd, spec.Stdin), nil
+}
+
+func (PooledDockerSandbox) Stream(ctx context.Context, spec RunSpec) (StreamHandles, error) {
+	return StreamHandles{}, fmt.Errorf("pooled backend does not support interactive streaming yet")
+}
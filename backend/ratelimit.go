@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/time/rate"
+)
+
+// =============================================================================
+// RATE LIMITING (token bucket, per-IP + global)
+// =============================================================================
+//
+// Each client IP gets its own token bucket (tokens refill at ipLimitRate/sec
+// up to ipLimitBurst) so short bursts are tolerated but sustained abuse isn't -
+// replacing the old rateLimiter map, which only counted concurrent executions
+// and never forgot an IP. A second, unkeyed bucket caps aggregate throughput
+// across every client. Limiter is pluggable so a single-replica deployment
+// runs the in-memory bucket while a multi-replica one shares state in Redis.
+
+var (
+	ipLimitRate      = rate.Limit(getFloatEnv("RATE_LIMIT_PER_IP", 1))
+	ipLimitBurst     = getIntEnv("RATE_LIMIT_BURST", 5)
+	globalLimitRate  = rate.Limit(getFloatEnv("RATE_LIMIT_GLOBAL", 20))
+	globalLimitBurst = getIntEnv("RATE_LIMIT_GLOBAL_BURST", 40)
+
+	idleGCAfter = 10 * time.Minute
+)
+
+func getFloatEnv(key string, fallback float64) float64 {
+	v, err := strconv.ParseFloat(getEnv(key, ""), 64)
+	if err != nil {
+		return fallback
+	}
+	return v
+}
+
+func getIntEnv(key string, fallback int) int {
+	v, err := strconv.Atoi(getEnv(key, ""))
+	if err != nil {
+		return fallback
+	}
+	return v
+}
+
+// Limiter decides whether a request from key (a client IP, or "" for the
+// global bucket) may proceed right now.
+type Limiter interface {
+	Allow(key string) bool
+}
+
+var limiter Limiter = newLimiterFromEnv()
+
+func newLimiterFromEnv() Limiter {
+	if addr := getEnv("REDIS_ADDR", ""); addr != "" {
+		return newRedisLimiter(addr)
+	}
+	return newMemoryLimiter()
+}
+
+// -----------------------------------------------------------------------------
+// In-memory limiter: one golang.org/x/time/rate.Limiter per key, with a
+// background sweep that evicts buckets idle longer than idleGCAfter so the
+// map doesn't grow unboundedly across distinct IPs.
+// -----------------------------------------------------------------------------
+
+type memoryLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+}
+
+type memoryBucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newMemoryLimiter() *memoryLimiter {
+	m := &memoryLimiter{buckets: map[string]*memoryBucket{}}
+	go m.gcLoop()
+	return m
+}
+
+func (m *memoryLimiter) bucketFor(key string) *memoryBucket {
+	r, burst := ipLimitRate, ipLimitBurst
+	if key == "" {
+		r, burst = globalLimitRate, globalLimitBurst
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &memoryBucket{limiter: rate.NewLimiter(r, burst)}
+		m.buckets[key] = b
+	}
+	b.lastSeen = time.Now()
+	return b
+}
+
+func (m *memoryLimiter) Allow(key string) bool {
+	return m.bucketFor(key).limiter.Allow()
+}
+
+func (m *memoryLimiter) gcLoop() {
+	for range time.Tick(idleGCAfter) {
+		cutoff := time.Now().Add(-idleGCAfter)
+		m.mu.Lock()
+		for key, b := range m.buckets {
+			if b.lastSeen.Before(cutoff) {
+				delete(m.buckets, key)
+			}
+		}
+		m.mu.Unlock()
+	}
+}
+
+// -----------------------------------------------------------------------------
+// Redis-backed limiter, for multi-replica deployments that need to share
+// bucket state. Approximates a token bucket with a fixed window counter -
+// INCR the per-key, per-window count and EXPIRE it on first increment - which
+// is coarser than a true token bucket but needs no Lua scripting dependency
+// and shares the fate of the rest of this codebase's Redis usage (jobs.go).
+// -----------------------------------------------------------------------------
+
+type redisLimiter struct {
+	client *redis.Client
+}
+
+func newRedisLimiter(addr string) *redisLimiter {
+	return &redisLimiter{client: redis.NewClient(&redis.Options{Addr: addr})}
+}
+
+func (l *redisLimiter) Allow(key string) bool {
+	r, burst := ipLimitRate, ipLimitBurst
+	if key == "" {
+		key = "global"
+		r, burst = globalLimitRate, globalLimitBurst
+	}
+
+	window := time.Second
+	limit := int64(float64(r) * window.Seconds())
+	if limit < 1 {
+		limit = 1
+	}
+	limit += int64(burst)
+
+	ctx := context.Background()
+	redisKey := "ratelimit:" + key
+	count, err := l.client.Incr(ctx, redisKey).Result()
+	if err != nil {
+		// Redis is unreachable: fail open rather than locking every client out.
+		return true
+	}
+	if count == 1 {
+		l.client.Expire(ctx, redisKey, window)
+	}
+	return count <= limit
+}
+
+// -----------------------------------------------------------------------------
+// Trusted proxies and client IP resolution
+// -----------------------------------------------------------------------------
+
+// trustedProxies lists the CIDRs allowed to set X-Forwarded-For/X-Real-IP;
+// those headers are ignored from any other source address.
+var trustedProxies = parseCIDRList(getEnv("TRUSTED_PROXIES", ""))
+
+func parseCIDRList(s string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if _, n, err := net.ParseCIDR(part); err == nil {
+			nets = append(nets, n)
+		}
+	}
+	return nets
+}
+
+func isTrustedProxy(remoteAddr string) bool {
+	if len(trustedProxies) == 0 {
+		return false // no allowlist configured: fail closed, never trust forwarding headers
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// getClientIP resolves the request's client IP, honoring X-Forwarded-For and
+// X-Real-IP only when the immediate peer is a trusted proxy.
+func getClientIP(r *http.Request) string {
+	if isTrustedProxy(r.RemoteAddr) {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			return strings.TrimSpace(strings.Split(fwd, ",")[0])
+		}
+		if real := r.Header.Get("X-Real-IP"); real != "" {
+			return strings.TrimSpace(real)
+		}
+	}
+	return r.RemoteAddr
+}
+
+// acquireSlot admits a request from ip, for the given endpoint, against both
+// its per-IP bucket and the shared global bucket, so a single abusive IP
+// can't drain capacity that should be shared.
+func acquireSlot(endpoint, ip string) bool {
+	if !limiter.Allow("") || !limiter.Allow(ip) {
+		rateLimitRejects.WithLabelValues(endpoint).Inc()
+		return false
+	}
+	return true
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestIsTrustedProxyFailsClosedByDefault(t *testing.T) {
+	saved := trustedProxies
+	defer func() { trustedProxies = saved }()
+
+	trustedProxies = nil
+	if isTrustedProxy("203.0.113.5:1234") {
+		t.Fatal("isTrustedProxy must fail closed when TRUSTED_PROXIES is unset")
+	}
+}
+
+func TestIsTrustedProxyHonorsConfiguredCIDR(t *testing.T) {
+	saved := trustedProxies
+	defer func() { trustedProxies = saved }()
+
+	trustedProxies = parseCIDRList("10.0.0.0/8")
+	if !isTrustedProxy("10.1.2.3:5678") {
+		t.Fatal("expected 10.1.2.3 to be trusted under 10.0.0.0/8")
+	}
+	if isTrustedProxy("203.0.113.5:1234") {
+		t.Fatal("expected 203.0.113.5 to remain untrusted")
+	}
+}
+
+func TestGetClientIPIgnoresHeadersWithoutTrustedProxy(t *testing.T) {
+	saved := trustedProxies
+	defer func() { trustedProxies = saved }()
+	trustedProxies = nil
+
+	r := &http.Request{Header: http.Header{}, RemoteAddr: "203.0.113.5:1234"}
+	r.Header.Set("X-Forwarded-For", "1.2.3.4")
+	r.Header.Set("X-Real-IP", "5.6.7.8")
+
+	if got := getClientIP(r); got != "203.0.113.5:1234" {
+		t.Fatalf("expected spoofed headers to be ignored, got %q", got)
+	}
+}
+
+func TestGetClientIPHonorsHeadersFromTrustedProxy(t *testing.T) {
+	saved := trustedProxies
+	defer func() { trustedProxies = saved }()
+	trustedProxies = parseCIDRList("10.0.0.0/8")
+
+	r := &http.Request{Header: http.Header{}, RemoteAddr: "10.1.2.3:1234"}
+	r.Header.Set("X-Forwarded-For", "1.2.3.4, 10.1.2.3")
+
+	if got := getClientIP(r); got != "1.2.3.4" {
+		t.Fatalf("expected forwarded header to be honored, got %q", got)
+	}
+}
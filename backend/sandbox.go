@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/creack/pty"
+)
+
+// =============================================================================
+// SANDBOX BACKENDS
+// =============================================================================
+//
+// Sandbox abstracts over the mechanism used to isolate a user's code from the
+// host: plain containers, gVisor-wrapped containers, Firecracker microVMs, or
+// nsjail when Docker itself isn't available. Selection is config-driven via
+// SANDBOX_BACKEND, with an optional per-language override on LangConfig.Sandbox.
+
+// RunSpec describes a single execution handed to a Sandbox. TempDir is a
+// host directory already populated with the source file(s) to run.
+type RunSpec struct {
+	Lang    LangConfig
+	Code    string
+	Stdin   string
+	TempDir string
+
+	// CacheMount, when set, is a host directory of resolved dependencies
+	// (see builder.go) bind-mounted read-only at CacheMountPath.
+	CacheMount     string
+	CacheMountPath string
+}
+
+type RunResult struct {
+	Stdout    string
+	Stderr    string
+	Success   bool
+	ExitCode  int
+	OOMKilled bool
+}
+
+// StreamHandles exposes the pipes needed to drive an interactive session
+// started by Sandbox.Stream. When Pty is non-nil the backend allocated a
+// real pseudoterminal, so Stdin/Stdout/Stderr all alias the same *os.File
+// (stdout/stderr are merged, as with any terminal) and Resize is usable.
+type StreamHandles struct {
+	Stdin  io.WriteCloser
+	Stdout io.ReadCloser
+	Stderr io.ReadCloser
+	Pty    *os.File
+	Wait   func() error
+}
+
+// Resize applies a terminal size change, a no-op when the backend has no PTY.
+func (h StreamHandles) Resize(cols, rows int) error {
+	if h.Pty == nil {
+		return nil
+	}
+	return pty.Setsize(h.Pty, &pty.Winsize{Cols: uint16(cols), Rows: uint16(rows)})
+}
+
+type Sandbox interface {
+	Run(ctx context.Context, spec RunSpec) (RunResult, error)
+	Stream(ctx context.Context, spec RunSpec) (StreamHandles, error)
+}
+
+var (
+	sandboxBackend = getEnv("SANDBOX_BACKEND", "docker") // docker|native|gvisor|firecracker|nsjail|pooled
+	seccompProfile = getEnv("SECCOMP_PROFILE", "")       // path to a Docker seccomp profile, "" = default
+)
+
+// resolveSandbox picks the backend for lang, honoring its per-language
+// override before falling back to the global SANDBOX_BACKEND setting. It
+// degrades to native whenever Docker isn't available on the host, but only
+// for the Docker-dependent backends (docker, gvisor, pooled); nsjail and
+// firecracker don't use Docker in the first place - nsjail exists precisely
+// for hosts where Docker is unavailable but root is, and firecracker drives
+// fc-runner directly - so forcing either down to native would silently
+// throw away the isolation an operator explicitly configured.
+func resolveSandbox(lang LangConfig) Sandbox {
+	backend := sandboxBackend
+	if lang.Sandbox != "" {
+		backend = lang.Sandbox
+	}
+	if !config.DockerAvail && backend != "native" && backend != "nsjail" && backend != "firecracker" {
+		backend = "native"
+	}
+
+	switch backend {
+	case "gvisor":
+		return GVisorSandbox{}
+	case "firecracker":
+		return FirecrackerSandbox{}
+	case "nsjail":
+		return NsjailSandbox{}
+	case "pooled":
+		if poolEnabled {
+			return PooledDockerSandbox{}
+		}
+		return DockerSandbox{}
+	case "native":
+		return NativeSandbox{}
+	default:
+		// RUNNER_POOL=1 opts every language that hasn't explicitly picked a
+		// different backend into the warm pool (see pool.go), so it's
+		// actually reachable from /api/run without also setting
+		// SANDBOX_BACKEND=pooled.
+		if poolEnabled {
+			return PooledDockerSandbox{}
+		}
+		return DockerSandbox{}
+	}
+}
+
+func runCmd(ctx context.Context, cmd *exec.Cmd, stdin string) RunResult {
+	cmd.Stdin = strings.NewReader(stdin)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &limitedWriter{w: &stdout, limit: config.MaxOutputSize}
+	cmd.Stderr = &limitedWriter{w: &stderr, limit: config.MaxOutputSize}
+
+	err := cmd.Run()
+
+	res := RunResult{
+		Stdout:  stdout.String(),
+		Stderr:  stderr.String(),
+		Success: err == nil,
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		res.ExitCode = exitErr.ExitCode()
+	} else if err != nil {
+		res.ExitCode = -1
+	}
+	if err != nil && res.Stderr == "" {
+		res.Stderr = err.Error()
+	}
+	return res
+}
+
+// streamCmd starts cmd attached to a real pseudoterminal so curses/readline
+// and other ANSI programs behave as they would in an actual terminal. Since
+// stdout and stderr are merged by the PTY, both map to the same *os.File;
+// callers that need docker's stdout/stderr distinction use Run instead.
+func streamCmd(cmd *exec.Cmd) (StreamHandles, error) {
+	ptmx, err := pty.Start(cmd)
+	if err != nil {
+		return StreamHandles{}, err
+	}
+	return StreamHandles{
+		Stdin:  ptmx,
+		Stdout: ptmx,
+		Stderr: ptmx,
+		Pty:    ptmx,
+		Wait:   cmd.Wait,
+	}, nil
+}
+
+// -----------------------------------------------------------------------------
+// DockerSandbox: a fresh `docker run` container per job, removed after it
+// exits (the current default path).
+// -----------------------------------------------------------------------------
+
+type DockerSandbox struct{}
+
+func (DockerSandbox) args(spec RunSpec, runtime string, tty bool) []string {
+	return dockerSandboxArgs(spec, runtime, tty, "")
+}
+
+// dockerSandboxArgs builds the `docker run` argv shared by every Docker-based
+// backend. name, when set, replaces --rm with --name so the caller can
+// `docker inspect` the container for OOMKilled before removing it itself;
+// callers that don't need that (Stream, GVisor) pass "" and get the usual
+// auto-removing --rm container.
+func dockerSandboxArgs(spec RunSpec, runtime string, tty bool, name string) []string {
+	runCmd := spec.Lang.Run
+	if spec.Lang.Compile != "" {
+		runCmd = spec.Lang.Compile + " && " + spec.Lang.Run
+	}
+
+	args := []string{"run", "-i"}
+	if name != "" {
+		args = append(args, "--name", name)
+	} else {
+		args = append(args, "--rm")
+	}
+	if tty {
+		args = append(args, "-t")
+	}
+	args = append(args, "--network=none")
+	if runtime != "" {
+		args = append(args, "--runtime="+runtime)
+	}
+	args = append(args,
+		"--memory=256m",
+		"--memory-swap=256m",
+		"--cpus=1.0",
+		"--pids-limit=128",
+		"--read-only",
+		"--cap-drop=ALL",
+		"--security-opt", "no-new-privileges",
+	)
+	if seccompProfile != "" {
+		args = append(args, "--security-opt", "seccomp="+seccompProfile)
+	}
+	args = append(args,
+		"--ulimit", "fsize=10485760:10485760",
+		"--ulimit", "nofile=256:256",
+		"--tmpfs", "/tmp:rw,exec,size=64m",
+		"-v", spec.TempDir+":/app:rw",
+	)
+	if spec.CacheMount != "" {
+		args = append(args, "-v", spec.CacheMount+":"+spec.CacheMountPath+":ro")
+	}
+	args = append(args,
+		"-w", "/app",
+		spec.Lang.Image,
+		"sh", "-c", runCmd,
+	)
+	return args
+}
+
+func (d DockerSandbox) Run(ctx context.Context, spec RunSpec) (RunResult, error) {
+	// Named instead of --rm so the container survives long enough, after it
+	// exits, for dockerInspectOOMKilled to read its State.OOMKilled before
+	// this function removes it itself.
+	name := "runner-" + genTraceID()
+	cmd := exec.CommandContext(ctx, "docker", dockerSandboxArgs(spec, "", false, name)...)
+	res := runCmd(ctx, cmd, spec.Stdin)
+	res.OOMKilled = dockerInspectOOMKilled(name)
+	exec.Command("docker", "rm", "-f", name).Run()
+	return res, nil
+}
+
+// dockerInspectOOMKilled reports whether the container named name was killed
+// by the kernel OOM killer, per Docker's own cgroup-backed accounting.
+func dockerInspectOOMKilled(name string) bool {
+	out, err := exec.Command("docker", "inspect", name, "--format", "{{.State.OOMKilled}}").Output()
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(string(out)) == "true"
+}
+
+func (d DockerSandbox) Stream(ctx context.Context, spec RunSpec) (StreamHandles, error) {
+	cmd := exec.CommandContext(ctx, "docker", d.args(spec, "", true)...)
+	return streamCmd(cmd)
+}
+
+// -----------------------------------------------------------------------------
+// GVisorSandbox: Docker with the runsc OCI runtime for an extra syscall-filter
+// layer when the workload doesn't justify a full microVM.
+// -----------------------------------------------------------------------------
+
+type GVisorSandbox struct{}
+
+func (GVisorSandbox) Run(ctx context.Context, spec RunSpec) (RunResult, error) {
+	d := DockerSandbox{}
+	cmd := exec.CommandContext(ctx, "docker", d.args(spec, "runsc", false)...)
+	return runCmd(ctx, cmd, spec.Stdin), nil
+}
+
+func (GVisorSandbox) Stream(ctx context.Context, spec RunSpec) (StreamHandles, error) {
+	d := DockerSandbox{}
+	cmd := exec.CommandContext(ctx, "docker", d.args(spec, "runsc", true)...)
+	return streamCmd(cmd)
+}
+
+// -----------------------------------------------------------------------------
+// FirecrackerSandbox: spawns a microVM per job from a prebuilt per-language
+// rootfs. Delegates to an external `fc-runner` wrapper (kernel/rootfs paths,
+// tap device and jailer setup are host-provisioning concerns, not this
+// process's) which mirrors the docker `sh -c runCmd` contract over vsock.
+// -----------------------------------------------------------------------------
+
+type FirecrackerSandbox struct{}
+
+func (FirecrackerSandbox) runCmd(spec RunSpec) string {
+	runCmd := spec.Lang.Run
+	if spec.Lang.Compile != "" {
+		runCmd = spec.Lang.Compile + " && " + spec.Lang.Run
+	}
+	return runCmd
+}
+
+func (f FirecrackerSandbox) args(spec RunSpec) []string {
+	args := []string{
+		"--rootfs", spec.Lang.Image + ".rootfs.ext4",
+		"--workdir", spec.TempDir,
+	}
+	if spec.CacheMount != "" {
+		args = append(args, "--mount", spec.CacheMount+":"+spec.CacheMountPath+":ro")
+	}
+	return append(args, "--", "sh", "-c", f.runCmd(spec))
+}
+
+func (f FirecrackerSandbox) Run(ctx context.Context, spec RunSpec) (RunResult, error) {
+	cmd := exec.CommandContext(ctx, "fc-runner", f.args(spec)...)
+	return runCmd(ctx, cmd, spec.Stdin), nil
+}
+
+func (f FirecrackerSandbox) Stream(ctx context.Context, spec RunSpec) (StreamHandles, error) {
+	cmd := exec.CommandContext(ctx, "fc-runner", f.args(spec)...)
+	return streamCmd(cmd)
+}
+
+// -----------------------------------------------------------------------------
+// NsjailSandbox: chroot + seccomp + user namespaces, for hosts where Docker
+// isn't available but the process has the privileges nsjail needs.
+// -----------------------------------------------------------------------------
+
+type NsjailSandbox struct{}
+
+func (NsjailSandbox) args(spec RunSpec) []string {
+	runCmd := spec.Lang.Run
+	if spec.Lang.Compile != "" {
+		runCmd = spec.Lang.Compile + " && " + spec.Lang.Run
+	}
+
+	args := []string{
+		"--mode", "o",
+		"--chroot", spec.TempDir,
+		"--user", "nobody",
+		"--group", "nogroup",
+		"--disable_clone_newnet=false",
+		"--rlimit_as", "256",
+		"--rlimit_cpu", "10",
+		"--rlimit_nofile", "256",
+		"--time_limit", "10",
+	}
+	if seccompProfile != "" {
+		args = append(args, "--seccomp_policy_file", seccompProfile)
+	}
+	if spec.CacheMount != "" {
+		args = append(args, "--bindmount_ro", spec.CacheMount+":"+spec.CacheMountPath)
+	}
+	args = append(args, "--", "/bin/sh", "-c", runCmd)
+	return args
+}
+
+func (n NsjailSandbox) Run(ctx context.Context, spec RunSpec) (RunResult, error) {
+	cmd := exec.CommandContext(ctx, "nsjail", n.args(spec)...)
+	return runCmd(ctx, cmd, spec.Stdin), nil
+}
+
+func (n NsjailSandbox) Stream(ctx context.Context, spec RunSpec) (StreamHandles, error) {
+	cmd := exec.CommandContext(ctx, "nsjail", n.args(spec)...)
+	return streamCmd(cmd)
+}
+
+// -----------------------------------------------------------------------------
+// NativeSandbox: no isolation at all, the pre-existing Termux/no-Docker
+// fallback. Only safe for trusted interpreted-language use.
+// -----------------------------------------------------------------------------
+
+type NativeSandbox struct{}
+
+func (NativeSandbox) command(ctx context.Context, spec RunSpec, codePath string) (*exec.Cmd, error) {
+	var cmd *exec.Cmd
+	switch spec.Lang.Filename {
+	case "main.py":
+		cmd = exec.CommandContext(ctx, "python3", codePath)
+	case "main.js":
+		cmd = exec.CommandContext(ctx, "node", codePath)
+	default:
+		return nil, errUnsupportedNative
+	}
+	cmd.Dir = spec.TempDir
+	return cmd, nil
+}
+
+func (n NativeSandbox) Run(ctx context.Context, spec RunSpec) (RunResult, error) {
+	codePath := spec.TempDir + "/" + spec.Lang.Filename
+	cmd, err := n.command(ctx, spec, codePath)
+	if err != nil {
+		return RunResult{Stderr: "Native execution not supported for this language. Install Docker."}, nil
+	}
+	return runCmd(ctx, cmd, spec.Stdin), nil
+}
+
+func (n NativeSandbox) Stream(ctx context.Context, spec RunSpec) (StreamHandles, error) {
+	codePath := spec.TempDir + "/" + spec.Lang.Filename
+	cmd, err := n.command(ctx, spec, codePath)
+	if err != nil {
+		return StreamHandles{}, err
+	}
+	return streamCmd(cmd)
+}
+
+var errUnsupportedNative = &unsupportedNativeError{}
+
+type unsupportedNativeError struct{}
+
+func (*unsupportedNativeError) Error() string {
+	return "native execution not supported for this language"
+}
@@ -0,0 +1,60 @@
+package main
+
+import "testing"
+
+// withSandboxEnv saves and restores the globals resolveSandbox reads, so
+// tests can freely mutate them without leaking state into other tests.
+func withSandboxEnv(t *testing.T, dockerAvail bool, backend string, pool bool, fn func()) {
+	t.Helper()
+	savedAvail, savedBackend, savedPool := config.DockerAvail, sandboxBackend, poolEnabled
+	config.DockerAvail, sandboxBackend, poolEnabled = dockerAvail, backend, pool
+	defer func() { config.DockerAvail, sandboxBackend, poolEnabled = savedAvail, savedBackend, savedPool }()
+	fn()
+}
+
+func TestResolveSandboxDowngradesDockerBackendsWithoutDocker(t *testing.T) {
+	withSandboxEnv(t, false, "docker", false, func() {
+		if _, ok := resolveSandbox(LangConfig{}).(NativeSandbox); !ok {
+			t.Fatal("expected docker backend to downgrade to native when Docker is unavailable")
+		}
+	})
+	withSandboxEnv(t, false, "gvisor", false, func() {
+		if _, ok := resolveSandbox(LangConfig{}).(NativeSandbox); !ok {
+			t.Fatal("expected gvisor backend to downgrade to native when Docker is unavailable")
+		}
+	})
+	withSandboxEnv(t, false, "pooled", false, func() {
+		if _, ok := resolveSandbox(LangConfig{}).(NativeSandbox); !ok {
+			t.Fatal("expected pooled backend to downgrade to native when Docker is unavailable")
+		}
+	})
+}
+
+func TestResolveSandboxLeavesNsjailAndFirecrackerAlone(t *testing.T) {
+	withSandboxEnv(t, false, "nsjail", false, func() {
+		if _, ok := resolveSandbox(LangConfig{}).(NsjailSandbox); !ok {
+			t.Fatal("expected nsjail to run as configured even without Docker")
+		}
+	})
+	withSandboxEnv(t, false, "firecracker", false, func() {
+		if _, ok := resolveSandbox(LangConfig{}).(FirecrackerSandbox); !ok {
+			t.Fatal("expected firecracker to run as configured even without Docker")
+		}
+	})
+}
+
+func TestResolveSandboxHonorsPerLanguageOverride(t *testing.T) {
+	withSandboxEnv(t, true, "docker", false, func() {
+		if _, ok := resolveSandbox(LangConfig{Sandbox: "nsjail"}).(NsjailSandbox); !ok {
+			t.Fatal("expected lang.Sandbox override to win over SANDBOX_BACKEND")
+		}
+	})
+}
+
+func TestResolveSandboxUsesPoolWhenEnabled(t *testing.T) {
+	withSandboxEnv(t, true, "docker", true, func() {
+		if _, ok := resolveSandbox(LangConfig{}).(PooledDockerSandbox); !ok {
+			t.Fatal("expected RUNNER_POOL to opt the default docker backend into the warm pool")
+		}
+	})
+}